@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// BackoffConfig is the JSON shape for a tester's `backoff` block. Type
+// selects the strategy: "fixed" replays the legacy errorWaitIntervals
+// sequence, "exponential" computes min(Max, Min*Factor^attempt) and
+// optionally randomizes it when Jitter is set.
+type BackoffConfig struct {
+	Type   string  `json:"type"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Factor float64 `json:"factor"`
+	Jitter bool    `json:"jitter"`
+}
+
+// Backoff tracks the retry attempt count for a single tester and hands out
+// the next wait duration on each call to Duration. It is not safe for
+// concurrent use; each tester goroutine owns its own instance.
+type Backoff struct {
+	BackoffConfig
+
+	// Fixed holds the legacy errorWaitIntervals sequence, consulted when
+	// Type is "fixed" or left empty.
+	Fixed []int
+
+	attempt int
+}
+
+// Duration returns the wait for the current attempt and advances the
+// internal attempt counter.
+func (b *Backoff) Duration() time.Duration {
+	if b.Type == "exponential" {
+		return b.exponential()
+	}
+	return b.fixed()
+}
+
+func (b *Backoff) fixed() time.Duration {
+	if len(b.Fixed) == 0 {
+		return 0
+	}
+
+	idx := b.attempt
+	if idx >= len(b.Fixed) {
+		idx = len(b.Fixed) - 1
+	}
+	b.attempt++
+
+	return time.Duration(b.Fixed[idx]) * time.Second
+}
+
+func (b *Backoff) exponential() time.Duration {
+	min := b.Min
+	if min <= 0 {
+		min = 1
+	}
+	max := b.Max
+	if max <= 0 {
+		max = 60
+	}
+	factor := b.Factor
+	if factor <= 0 {
+		factor = 2
+	}
+
+	computed := min * math.Pow(factor, float64(b.attempt))
+	if computed > max {
+		computed = max
+	}
+	b.attempt++
+
+	wait := computed
+	if b.Jitter && computed > min {
+		wait = min + rand.Float64()*(computed-min)
+	}
+
+	return time.Duration(wait * float64(time.Second))
+}
+
+// Reset clears the attempt counter. Call it on the first successful
+// request after a run of failures so the next error starts the backoff
+// sequence from the beginning again.
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
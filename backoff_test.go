@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBackoffExponential(t *testing.T) {
+	cases := []struct {
+		name  string
+		cfg   BackoffConfig
+		calls int // number of Duration() calls; the last one is checked
+		want  time.Duration
+	}{
+		{"defaults, first attempt", BackoffConfig{Type: "exponential"}, 1, 1 * time.Second},
+		{"defaults, second attempt doubles", BackoffConfig{Type: "exponential"}, 2, 2 * time.Second},
+		{"defaults, third attempt doubles again", BackoffConfig{Type: "exponential"}, 3, 4 * time.Second},
+		{"caps at configured max", BackoffConfig{Type: "exponential", Min: 1, Max: 5, Factor: 2}, 4, 5 * time.Second},
+		{"custom min and factor", BackoffConfig{Type: "exponential", Min: 2, Max: 100, Factor: 3}, 1, 2 * time.Second},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := &Backoff{BackoffConfig: c.cfg}
+
+			var got time.Duration
+			for i := 0; i < c.calls; i++ {
+				got = b.Duration()
+			}
+
+			if got != c.want {
+				t.Errorf("Duration() after %d calls = %v, want %v", c.calls, got, c.want)
+			}
+		})
+	}
+}
+
+func TestBackoffExponentialJitterStaysInRange(t *testing.T) {
+	cfg := BackoffConfig{Type: "exponential", Min: 1, Max: 60, Factor: 2, Jitter: true}
+	b := &Backoff{BackoffConfig: cfg}
+
+	for attempt := 0; attempt < 6; attempt++ {
+		computed := math.Min(cfg.Min*math.Pow(cfg.Factor, float64(attempt)), cfg.Max)
+		min := time.Duration(cfg.Min * float64(time.Second))
+		max := time.Duration(computed * float64(time.Second))
+
+		got := b.Duration()
+		if got < min || got > max {
+			t.Errorf("attempt %d: Duration() = %v, want within [%v, %v]", attempt, got, min, max)
+		}
+	}
+}
+
+func TestBackoffExponentialResetRestartsSequence(t *testing.T) {
+	b := &Backoff{BackoffConfig: BackoffConfig{Type: "exponential", Min: 1, Max: 60, Factor: 2}}
+
+	first := b.Duration()
+	b.Duration()
+	b.Reset()
+
+	afterReset := b.Duration()
+	if afterReset != first {
+		t.Errorf("Duration() after Reset() = %v, want %v (same as first call)", afterReset, first)
+	}
+}
+
+func TestBackoffFixed(t *testing.T) {
+	b := &Backoff{Fixed: []int{1, 2, 5}}
+
+	want := []time.Duration{1 * time.Second, 2 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := b.Duration(); got != w {
+			t.Errorf("call %d: Duration() = %v, want %v", i, got, w)
+		}
+	}
+}
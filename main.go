@@ -1,41 +1,105 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	_ "github.com/mattn/go-sqlite3"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Config is the top-level shape of config.json.
+type Config struct {
+	Testers []Tester      `json:"testers"`
+	Storage StorageConfig `json:"storage"`
+	Listen  string        `json:"listen"`
+}
+
 type Tester struct {
-	Name               string `json:"name"`
-	URL                string `json:"url"`
-	Rate               string `json:"rate"`
-	MaxRequests        int    `json:"maxRequests"`
-	Proxy              string `json:"proxy"`
-	ErrorWaitIntervals []int  `json:"errorWaitIntervals"`
+	Name               string        `json:"name"`
+	URL                string        `json:"url"`
+	Rate               string        `json:"rate"`
+	Burst              int           `json:"burst"`
+	Concurrency        int           `json:"concurrency"`
+	MaxRequests        int           `json:"maxRequests"`
+	Proxy              string        `json:"proxy"`
+	ErrorWaitIntervals []int         `json:"errorWaitIntervals"`
+	Backoff            BackoffConfig `json:"backoff"`
+
+	// Single-step request definition, used when Steps is empty.
+	Method       string            `json:"method"`
+	Headers      map[string]string `json:"headers"`
+	Body         string            `json:"body"`
+	BodyTemplate string            `json:"bodyTemplate"`
+	ExpectStatus []int             `json:"expectStatus"`
+
+	// Steps, when set, runs a sequence of requests per iteration instead
+	// of a single one (e.g. login -> token -> API call).
+	Steps []RequestSpec `json:"steps"`
 }
 
+// Result tracks a tester's running counters. Its fields are written from
+// the tester's worker goroutines and read from the reporter goroutine and
+// the /status HTTP handler, so everything here is atomic.
+//
+// Batch windows (successes/failures/durations since the last time a batch
+// was logged) are deliberately NOT kept here: with concurrency>1, several
+// workers share one Result, and a per-window count that one worker resets
+// while another is mid-window would be meaningless. That bookkeeping is
+// worker-local instead; see the batch accounting in main's tester loop.
 type Result struct {
-	Endpoint             string
-	SuccessfulCount      int
-	BatchSuccessfulCount int
-	ErrorCount           int
-	BatchErrorCount      int
-	RequestsPerSecond    float64
-	ErrorWait            time.Duration
-	SleepStatus          bool
-	TotalSuccessTime     time.Duration
+	Endpoint string
+
+	SuccessfulCount   atomic.Uint64
+	ErrorCount        atomic.Uint64
+	RequestsPerSecond atomic.Uint64 // math.Float64bits
+	ErrorWait         atomic.Int64  // time.Duration nanoseconds
+	SleepStatus       atomic.Bool
+}
+
+// SetRequestsPerSecond stores a float64 requests/s value atomically.
+func (r *Result) SetRequestsPerSecond(v float64) {
+	r.RequestsPerSecond.Store(math.Float64bits(v))
+}
+
+// GetRequestsPerSecond loads the requests/s value stored by SetRequestsPerSecond.
+func (r *Result) GetRequestsPerSecond() float64 {
+	return math.Float64frombits(r.RequestsPerSecond.Load())
+}
+
+// ResultSnapshot is a point-in-time, JSON-friendly copy of a Result, used
+// by the terminal reporter and the /status endpoint.
+type ResultSnapshot struct {
+	Endpoint          string  `json:"endpoint"`
+	SuccessfulCount   uint64  `json:"successfulCount"`
+	ErrorCount        uint64  `json:"errorCount"`
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	ErrorWait         string  `json:"errorWait"`
+	SleepStatus       bool    `json:"sleepStatus"`
+}
+
+// Snapshot copies the current counters out for display or serialization.
+func (r *Result) Snapshot() ResultSnapshot {
+	return ResultSnapshot{
+		Endpoint:          r.Endpoint,
+		SuccessfulCount:   r.SuccessfulCount.Load(),
+		ErrorCount:        r.ErrorCount.Load(),
+		RequestsPerSecond: r.GetRequestsPerSecond(),
+		ErrorWait:         time.Duration(r.ErrorWait.Load()).String(),
+		SleepStatus:       r.SleepStatus.Load(),
+	}
 }
 
 func main() {
 	configFile := flag.String("config", "config.json", "path to the configuration file")
+	dryRun := flag.Bool("dry-run", false, "print the computed pacing schedule and exit without sending any requests")
 	flag.Parse()
 
 	if *configFile == "" {
@@ -49,7 +113,17 @@ func main() {
 		os.Exit(1)
 	}
 
-	db, err := databaseInit("rateprowler.db")
+	if *dryRun {
+		printDryRunSchedule(config)
+		return
+	}
+
+	store, err := NewStore(config.Storage)
+	if err != nil {
+		fmt.Printf("error opening storage: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
 
 	var results []*Result
 	var wg sync.WaitGroup
@@ -64,154 +138,240 @@ func main() {
 	go func() {
 		for range time.Tick(time.Second) {
 			for _, r := range results {
+				s := r.Snapshot()
 				fmt.Printf("[%s] %s: %d successful, %d errors, %.2f requests/s, sleeping: %t, error wait: %s\n", time.Now().Format("2006-01-02 15:04:05"),
-					r.Endpoint, r.SuccessfulCount, r.ErrorCount, r.RequestsPerSecond, r.SleepStatus, r.ErrorWait.String())
+					s.Endpoint, s.SuccessfulCount, s.ErrorCount, s.RequestsPerSecond, s.SleepStatus, s.ErrorWait)
 			}
 		}
 	}()
 
-	// start testers
-	for i, tester := range config.Testers {
-		wg.Add(100000)
-		go func(i int, tester Tester) {
-			defer wg.Done()
-
-			transport := &http.Transport{
-				TLSHandshakeTimeout: 10 * time.Second,
-				MaxIdleConns:        0,
+	// expose /metrics and /status if configured
+	if config.Listen != "" {
+		metricsServer := NewMetricsServer(config.Listen, results)
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fmt.Printf("metrics server error: %v\n", err)
 			}
+		}()
+	}
 
-			// set proxy if specified
-			if tester.Proxy != "" {
-				proxyURL, err := url.Parse(tester.Proxy)
-				if err != nil {
-					fmt.Printf("[%s] error parsing proxy: %s (%v)\n", tester.URL, tester.Proxy, err)
-					return
-				}
-				transport.Proxy = http.ProxyURL(proxyURL)
-			}
+	// start testers
+	for i, tester := range config.Testers {
+		limiter, err := newLimiter(tester.Rate, tester.Burst)
+		if err != nil {
+			fmt.Printf("[%s] error parsing rate value for endpoint: %s (%v)\n", tester.Name, tester.Rate, err)
+			continue
+		}
+		configuredLimit := limiter.Limit()
 
-			// set up http client
-			client := &http.Client{
-				Timeout:   time.Second * 5,
-				Transport: transport,
-			}
+		transport := &http.Transport{
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        0,
+		}
 
-			rate, err := parseRate(tester.Rate)
+		// set proxy if specified
+		if tester.Proxy != "" {
+			proxyURL, err := url.Parse(tester.Proxy)
 			if err != nil {
-				fmt.Printf("[%s] error parsing rate value for endpoint: %s (%v)\n", tester.Name, tester.Rate, err)
-				return
+				fmt.Printf("[%s] error parsing proxy: %s (%v)\n", tester.URL, tester.Proxy, err)
+				continue
 			}
+			transport.Proxy = http.ProxyURL(proxyURL)
+		}
 
-			requestCount := 0
-			waitIndex := 0
-			errorWait := time.Duration(0)
-			lastError := time.Time{}
-
-			batchStartTime := time.Now()
-
-			for requestCount < tester.MaxRequests {
-				// wait for rate limit
-
-				time.Sleep(rate.waitTime())
-
-				// send request
-				resp, err := client.Get(tester.URL)
-
-				if err != nil || resp.StatusCode > 400 && resp.StatusCode < 500 {
-					// handle failed request
-					if err != nil {
-						// log error to database
-						db.Exec("INSERT INTO errors (name, type, error, timestamp) VALUES (?, ?, ?)", tester.Name, "sys", err, time.Now().Unix())
-					} else {
-						db.Exec("INSERT INTO errors (name, type, status, timestamp) VALUES (?, ?, ?, ?)", tester.Name, "http", resp.StatusCode, time.Now().Unix())
-					}
-
-					if requestCount == 0 {
-						// tell the user that we're having errors on the first request
-						fmt.Printf("[%s] error on first request to endpoint: %s\n", time.Now().Format("2006-01-02 15:04:05"), tester.Name)
-					}
+		// set up http client, shared by every worker for this tester
+		client := &http.Client{
+			Timeout:   time.Second * 5,
+			Transport: transport,
+		}
 
-					results[i].ErrorCount++
-					results[i].BatchErrorCount++
+		concurrency := tester.Concurrency
+		if concurrency <= 0 {
+			concurrency = 1
+		}
 
-					// wait using error wait intervals
-					if waitIndex < len(tester.ErrorWaitIntervals) {
-						errorWait = time.Duration(tester.ErrorWaitIntervals[waitIndex]) * time.Second
-						waitIndex++
+		var requestCount atomic.Int64
+
+		wg.Add(concurrency)
+		for w := 0; w < concurrency; w++ {
+			go func(i int, tester Tester) {
+				defer wg.Done()
+
+				errorWait := time.Duration(0)
+				lastError := time.Time{}
+				backoff := &Backoff{BackoffConfig: tester.Backoff, Fixed: tester.ErrorWaitIntervals}
+
+				// batch window bookkeeping: worker-local, since each
+				// worker logs its own batches independently rather than
+				// racing other workers over shared counters.
+				batchStartTime := time.Now()
+				batchSuccesses := 0
+				batchErrors := 0
+				totalSuccessTime := time.Duration(0)
+
+				for {
+					n := requestCount.Add(1) - 1
+					if n >= int64(tester.MaxRequests) {
+						return
 					}
 
-					results[i].TotalSuccessTime = time.Since(batchStartTime)
-					batchStartTime = time.Now()
-
-					// time of the last error
-					if lastError.IsZero() {
-						lastError = time.Now()
+					// wait for a token from the rate limiter
+					if err := limiter.Wait(context.Background()); err != nil {
+						return
 					}
 
-					// sleep zzz
-					results[i].SleepStatus = true
-					time.Sleep(errorWait)
-
-					// wake up aaa
-					results[i].SleepStatus = false
+					// run one iteration in its own function so the
+					// response body is always drained and closed when it
+					// falls out of scope, however this iteration exits.
+					// It reports whether a config error made this tester
+					// un-runnable, in which case the worker stops instead
+					// of retrying the same broken config forever.
+					fatal := func() bool {
+						// send request(s) for this iteration
+						reqStart := time.Now()
+						resp, expectStatus, err := runIteration(client, tester, int(n))
+						defer drainAndClose(resp)
+						requestLatency.WithLabelValues(tester.Name).Observe(time.Since(reqStart).Seconds())
+
+						if err == nil && resp != nil {
+							throttleFromHeaders(limiter, parseRateLimitHeaders(resp), configuredLimit)
+						}
 
-				} else if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-					// handle successful request
-					results[i].SuccessfulCount++
-					results[i].BatchSuccessfulCount++
-					results[i].RequestsPerSecond = float64(results[i].SuccessfulCount) / time.Since(startTime).Seconds()
+						if err == nil && resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+							// the server told us exactly how long to wait;
+							// honor that instead of the generic backoff
+							retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"))
+							if !ok {
+								retryAfter = backoff.Duration()
+							}
 
-					// reset wait interval
-					if waitIndex > 0 {
-						waitIndex = 0
-					}
+							store.LogRateLimit(tester.Name, retryAfter, int(n)+1, results[i].GetRequestsPerSecond())
+							requestsTotal.WithLabelValues(tester.Name, fmt.Sprintf("%d", resp.StatusCode)).Inc()
 
-					// log a success after we've experienced some failures
-					if !lastError.IsZero() {
-						endError := time.Now()
+							results[i].ErrorCount.Add(1)
+							batchErrors++
 
-						// how long did this batch run for
-						totalErrorWait := endError.Sub(lastError)
+							results[i].SleepStatus.Store(true)
+							sleepGauge.WithLabelValues(tester.Name).Set(1)
+							errorWaitSeconds.WithLabelValues(tester.Name).Set(retryAfter.Seconds())
+							time.Sleep(retryAfter)
+							results[i].SleepStatus.Store(false)
+							sleepGauge.WithLabelValues(tester.Name).Set(0)
 
-						// how long did it spit errors?
-						results[i].ErrorWait = totalErrorWait
-
-						// reset the last error time
-						lastError = time.Time{}
+							return false
+						}
 
-						// log batch
-						batch := Batch{
-							Name:             tester.Name,
-							Successes:        results[i].BatchSuccessfulCount,
-							SuccessTime:      results[i].TotalSuccessTime,
-							Failures:         results[i].BatchErrorCount,
-							FailTime:         totalErrorWait,
-							LastWaitInterval: tester.ErrorWaitIntervals[waitIndex],
+						if err != nil || (err == nil && isErrorStatus(resp.StatusCode, expectStatus)) {
+							var configErr *ConfigError
+							if err != nil && errors.As(err, &configErr) {
+								// this tester's request/response templates are
+								// broken; no amount of retrying fixes that, so
+								// stop instead of backing off on it forever.
+								store.LogError(tester.Name, "config", 0, err.Error(), 0)
+								fmt.Printf("[%s] config error, stopping tester: %v\n", time.Now().Format("2006-01-02 15:04:05"), err)
+								return true
+							}
+
+							// wait using the configured backoff strategy
+							errorWait = backoff.Duration()
+
+							if err != nil {
+								store.LogError(tester.Name, "sys", 0, err.Error(), errorWait)
+								requestsTotal.WithLabelValues(tester.Name, "error").Inc()
+							} else {
+								store.LogError(tester.Name, "http", resp.StatusCode, "", errorWait)
+								requestsTotal.WithLabelValues(tester.Name, fmt.Sprintf("%d", resp.StatusCode)).Inc()
+							}
+
+							if n == 0 {
+								// tell the user that we're having errors on the first request
+								fmt.Printf("[%s] error on first request to endpoint: %s\n", time.Now().Format("2006-01-02 15:04:05"), tester.Name)
+							}
+
+							results[i].ErrorCount.Add(1)
+							batchErrors++
+
+							totalSuccessTime = time.Since(batchStartTime)
+							batchStartTime = time.Now()
+
+							// time of the last error
+							if lastError.IsZero() {
+								lastError = time.Now()
+							}
+
+							// sleep zzz
+							results[i].SleepStatus.Store(true)
+							sleepGauge.WithLabelValues(tester.Name).Set(1)
+							errorWaitSeconds.WithLabelValues(tester.Name).Set(errorWait.Seconds())
+							time.Sleep(errorWait)
+
+							// wake up aaa
+							results[i].SleepStatus.Store(false)
+							sleepGauge.WithLabelValues(tester.Name).Set(0)
+
+						} else if err == nil && isSuccessStatus(resp.StatusCode, expectStatus) {
+							// handle successful request
+							requestsTotal.WithLabelValues(tester.Name, fmt.Sprintf("%d", resp.StatusCode)).Inc()
+							successfulCount := results[i].SuccessfulCount.Add(1)
+							batchSuccesses++
+							rps := float64(successfulCount) / time.Since(startTime).Seconds()
+							results[i].SetRequestsPerSecond(rps)
+							requestsPerSecond.WithLabelValues(tester.Name).Set(rps)
+
+							// reset the backoff now that we've had a successful request
+							backoff.Reset()
+
+							// log a success after we've experienced some failures
+							if !lastError.IsZero() {
+								endError := time.Now()
+
+								// how long did this batch run for
+								totalErrorWait := endError.Sub(lastError)
+
+								// how long did it spit errors?
+								results[i].ErrorWait.Store(int64(totalErrorWait))
+
+								// reset the last error time
+								lastError = time.Time{}
+
+								// log batch
+								batch := Batch{
+									Name:            tester.Name,
+									Successes:       batchSuccesses,
+									SuccessTime:     totalSuccessTime,
+									Failures:        batchErrors,
+									FailTime:        totalErrorWait,
+									LastWaitSeconds: errorWait.Seconds(),
+								}
+
+								store.LogBatch(batch)
+								batchErrors = 0
+								batchSuccesses = 0
+							}
 						}
 
-						logBatch(db, batch)
-						results[i].BatchErrorCount = 0
-						results[i].BatchSuccessfulCount = 0
+						return false
+					}()
+
+					if fatal {
+						return
 					}
 				}
-				requestCount++
-			}
-
-		}(i, tester)
+			}(i, tester)
+		}
 	}
 
 	wg.Wait()
 }
 
-func loadConfig(filename string) (*struct{ Testers []Tester }, error) {
+func loadConfig(filename string) (*Config, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	var config struct{ Testers []Tester }
+	var config Config
 	err = json.NewDecoder(file).Decode(&config)
 	if err != nil {
 		return nil, err
@@ -220,101 +380,11 @@ func loadConfig(filename string) (*struct{ Testers []Tester }, error) {
 	return &config, nil
 }
 
-func parseRate(rate string) (*rateLimit, error) {
-	var rl rateLimit
-
-	if len(rate) < 2 {
-		return nil, fmt.Errorf("invalid rate: %s", rate)
-	}
-
-	switch rate[len(rate)-1] {
-	case 's':
-		rl.interval = time.Second
-	case 'm':
-		rl.interval = time.Minute
-	case 'h':
-		rl.interval = time.Hour
-	default:
-		return nil, fmt.Errorf("invalid rate: %s", rate)
-	}
-
-	rateValue := rate[:len(rate)-1]
-
-	fmt.Sscanf(rateValue, "%d", &rl.limit)
-
-	if rl.limit <= 0 {
-		return nil, fmt.Errorf("invalid rate: %s", rate)
-	}
-
-	return &rl, nil
-}
-
-type rateLimit struct {
-	limit    int
-	interval time.Duration
-}
-
-func (rl *rateLimit) waitTime() time.Duration {
-	return rl.interval / time.Duration(rl.limit)
-}
-
-func databaseInit(dbname string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", dbname)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
-	}
-
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS log (
-			id INTEGER PRIMARY KEY,
-      name TEXT,
-			successes INTEGER,
-			success_time TEXT,
-			failures INTEGER,
-			fail_time TEXT,
-      last_wait_interval INTEGER,
-			timestamp INT
-		)`)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create table: %w", err)
-	}
-
-	_, err = db.Exec(`
-      CREATE TABLE IF NOT EXISTS errors (
-      id INTEGER PRIMARY KEY,
-      name TEXT,
-      type TEXT,
-      status INT,
-      error TEXT,
-      timestamp INT
-    )`)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create table: %w", err)
-	}
-
-	return db, nil
-}
-
 type Batch struct {
-	Name             string
-	Successes        int
-	SuccessTime      time.Duration
-	Failures         int
-	FailTime         time.Duration
-	LastWaitInterval int
-}
-
-func logBatch(db *sql.DB, batch Batch) error {
-	// convert time.Duration to string
-	successTime := batch.SuccessTime.String()
-	failTime := batch.FailTime.String()
-	_, err := db.Exec(`
-		INSERT INTO log (name, successes, success_time, failures, fail_time, last_wait_interval, timestamp)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, batch.Name, batch.Successes, successTime, batch.Failures, failTime, batch.LastWaitInterval, time.Now().Unix())
-	if err != nil {
-		fmt.Printf("failed to log request: %s", err)
-	}
-
-	return nil
+	Name            string
+	Successes       int
+	SuccessTime     time.Duration
+	Failures        int
+	FailTime        time.Duration
+	LastWaitSeconds float64
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rateprowler_requests_total",
+		Help: "Total requests issued, labeled by tester and outcome (status code or \"error\").",
+	}, []string{"tester", "status"})
+
+	requestsPerSecond = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rateprowler_requests_per_second",
+		Help: "Current measured successful requests/second per tester.",
+	}, []string{"tester"})
+
+	sleepGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rateprowler_sleep",
+		Help: "1 while a tester is sleeping out an error wait, 0 otherwise.",
+	}, []string{"tester"})
+
+	errorWaitSeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rateprowler_error_wait_seconds",
+		Help: "Most recently applied error wait, in seconds, per tester.",
+	}, []string{"tester"})
+
+	requestLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rateprowler_request_duration_seconds",
+		Help:    "Request latency per tester.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"tester"})
+)
+
+// MetricsServer exposes /metrics (Prometheus text format) and /status (the
+// current []*Result as JSON) over HTTP.
+type MetricsServer struct {
+	results []*Result
+	srv     *http.Server
+}
+
+// NewMetricsServer builds a MetricsServer bound to listen; call
+// ListenAndServe to start it.
+func NewMetricsServer(listen string, results []*Result) *MetricsServer {
+	ms := &MetricsServer{results: results}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/status", ms.handleStatus)
+
+	ms.srv = &http.Server{Addr: listen, Handler: mux}
+	return ms
+}
+
+func (ms *MetricsServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	snapshots := make([]ResultSnapshot, len(ms.results))
+	for i, res := range ms.results {
+		snapshots[i] = res.Snapshot()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshots)
+}
+
+// ListenAndServe starts the embedded HTTP server; it blocks until the
+// server stops or fails.
+func (ms *MetricsServer) ListenAndServe() error {
+	return ms.srv.ListenAndServe()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// parseRetryAfter parses a Retry-After header value, which per RFC 7231
+// is either a number of seconds or an HTTP-date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if when, err := http.ParseTime(value); err == nil {
+		wait := time.Until(when)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+
+	return 0, false
+}
+
+// rateLimitHeaders holds the GitHub/Twitter-style X-RateLimit-* values
+// parsed off a response, when present.
+type rateLimitHeaders struct {
+	Remaining int
+	Reset     time.Time
+	Present   bool
+}
+
+func parseRateLimitHeaders(resp *http.Response) rateLimitHeaders {
+	remainingStr := resp.Header.Get("X-RateLimit-Remaining")
+	if remainingStr == "" {
+		return rateLimitHeaders{}
+	}
+
+	remaining, err := strconv.Atoi(remainingStr)
+	if err != nil {
+		return rateLimitHeaders{}
+	}
+
+	var reset time.Time
+	if resetStr := resp.Header.Get("X-RateLimit-Reset"); resetStr != "" {
+		if epoch, err := strconv.ParseInt(resetStr, 10, 64); err == nil {
+			reset = time.Unix(epoch, 0)
+		}
+	}
+
+	return rateLimitHeaders{Remaining: remaining, Reset: reset, Present: true}
+}
+
+// throttleFromHeaders lowers limiter's rate as the remaining quota
+// approaches zero, spreading what's left over the time until reset so
+// rateprowler backs off before the service starts rejecting requests
+// outright. Once headers.Reset has passed, it restores limiter to
+// configured (the tester's normal configured rate) before considering
+// whether the new window also needs throttling.
+func throttleFromHeaders(limiter *rate.Limiter, headers rateLimitHeaders, configured rate.Limit) {
+	if !headers.Present || headers.Reset.IsZero() {
+		return
+	}
+
+	if !time.Now().Before(headers.Reset) && limiter.Limit() != configured {
+		limiter.SetLimit(configured)
+	}
+
+	if headers.Remaining > 5 {
+		return
+	}
+
+	wait := time.Until(headers.Reset)
+	if wait <= 0 {
+		return
+	}
+
+	newRPS := float64(headers.Remaining+1) / wait.Seconds()
+	if newRPS <= 0 {
+		newRPS = 0.01
+	}
+
+	if rate.Limit(newRPS) < limiter.Limit() {
+		limiter.SetLimit(rate.Limit(newRPS))
+	}
+}
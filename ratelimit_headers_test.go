@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfterSeconds(t *testing.T) {
+	cases := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"120", 120 * time.Second, true},
+		{"0", 0, true},
+		{"  5  ", 5 * time.Second, true},
+		{"-5", 0, false},
+		{"", 0, false},
+		{"not-a-number-or-date", 0, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.value, func(t *testing.T) {
+			got, ok := parseRetryAfter(c.value)
+			if ok != c.wantOK {
+				t.Fatalf("parseRetryAfter(%q) ok = %v, want %v", c.value, ok, c.wantOK)
+			}
+			if ok && got != c.want {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", c.value, got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfterHTTPDate(t *testing.T) {
+	future := time.Now().Add(2 * time.Hour).UTC()
+	got, ok := parseRetryAfter(future.Format(http.TimeFormat))
+	if !ok {
+		t.Fatalf("parseRetryAfter(future date) ok = false, want true")
+	}
+	if got <= 0 || got > 2*time.Hour+time.Minute {
+		t.Errorf("parseRetryAfter(future date) = %v, want roughly 2h", got)
+	}
+
+	past := time.Now().Add(-2 * time.Hour).UTC()
+	got, ok = parseRetryAfter(past.Format(http.TimeFormat))
+	if !ok {
+		t.Fatalf("parseRetryAfter(past date) ok = false, want true")
+	}
+	if got != 0 {
+		t.Errorf("parseRetryAfter(past date) = %v, want 0 (clamped)", got)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// newLimiter builds a token-bucket limiter from a tester's `rate` string
+// (e.g. "10s" for 10/second, "300m" for 300/minute) and `burst` size. A
+// burst of zero or less defaults to 1, matching rate.Limiter's own
+// requirement that burst be at least as large as the largest single
+// request cost.
+func newLimiter(rateStr string, burst int) (*rate.Limiter, error) {
+	rps, err := parseRatePerSecond(rateStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if burst <= 0 {
+		burst = 1
+	}
+
+	return rate.NewLimiter(rate.Limit(rps), burst), nil
+}
+
+// parseRatePerSecond converts a "<n><unit>" rate string into requests per
+// second, where unit is one of s (second), m (minute), or h (hour).
+func parseRatePerSecond(rateStr string) (float64, error) {
+	if len(rateStr) < 2 {
+		return 0, fmt.Errorf("invalid rate: %s", rateStr)
+	}
+
+	var interval time.Duration
+	switch rateStr[len(rateStr)-1] {
+	case 's':
+		interval = time.Second
+	case 'm':
+		interval = time.Minute
+	case 'h':
+		interval = time.Hour
+	default:
+		return 0, fmt.Errorf("invalid rate: %s", rateStr)
+	}
+
+	var limit int
+	fmt.Sscanf(rateStr[:len(rateStr)-1], "%d", &limit)
+	if limit <= 0 {
+		return 0, fmt.Errorf("invalid rate: %s", rateStr)
+	}
+
+	return float64(limit) / interval.Seconds(), nil
+}
+
+// printDryRunSchedule prints the pacing each tester would run at without
+// sending any requests, for use with the -dry-run flag.
+func printDryRunSchedule(config *Config) {
+	fmt.Println("dry run: computed pacing schedule (no requests will be sent)")
+
+	for _, tester := range config.Testers {
+		rps, err := parseRatePerSecond(tester.Rate)
+		if err != nil {
+			fmt.Printf("  %s: invalid rate %q: %v\n", tester.Name, tester.Rate, err)
+			continue
+		}
+
+		burst := tester.Burst
+		if burst <= 0 {
+			burst = 1
+		}
+		concurrency := tester.Concurrency
+		if concurrency <= 0 {
+			concurrency = 1
+		}
+
+		// the limiter is shared by every worker for this tester, so
+		// concurrency only lets requests overlap in flight -- it does not
+		// raise the sustained token-refill rate.
+		estimate := "unknown"
+		if rps > 0 && tester.MaxRequests > 0 {
+			seconds := float64(tester.MaxRequests) / rps
+			estimate = time.Duration(seconds * float64(time.Second)).String()
+		}
+
+		fmt.Printf("  %s: %.2f req/s sustained (burst %d), %d worker(s) in flight, %d requests in ~%s\n",
+			tester.Name, rps, burst, concurrency, tester.MaxRequests, estimate)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestParseRatePerSecond(t *testing.T) {
+	cases := []struct {
+		rateStr string
+		want    float64
+		wantErr bool
+	}{
+		{"10s", 10, false},
+		{"300m", 5, false},
+		{"3600h", 1, false},
+		{"1s", 1, false},
+		{"0s", 0, true},
+		{"-5s", 0, true},
+		{"10x", 0, true},
+		{"s", 0, true},
+		{"", 0, true},
+		{"abcs", 0, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.rateStr, func(t *testing.T) {
+			got, err := parseRatePerSecond(c.rateStr)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("parseRatePerSecond(%q) = %v, nil, want an error", c.rateStr, got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parseRatePerSecond(%q) returned unexpected error: %v", c.rateStr, err)
+			}
+			if got != c.want {
+				t.Errorf("parseRatePerSecond(%q) = %v, want %v", c.rateStr, got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// RequestSpec describes a single HTTP call. A Tester without a `steps`
+// block is treated as a single-step scenario built from its own
+// method/url/headers/body fields; a Tester with `steps` runs each one in
+// order and the final step's response determines the iteration's outcome
+// (e.g. login -> token -> API call), unless a non-final step with its own
+// expectStatus list gets a status outside it, which ends the chain there.
+//
+// Capture lets a non-final step hand a piece of its response to later
+// steps: each key becomes a name usable as {{.Vars.<key>}} in a later
+// step's bodyTemplate or header value, and its value is either
+// "header:<Name>" to pull a response header or "json:<field>" to pull a
+// top-level field out of a JSON response body.
+type RequestSpec struct {
+	Method       string            `json:"method"`
+	URL          string            `json:"url"`
+	Headers      map[string]string `json:"headers"`
+	Body         string            `json:"body"`
+	BodyTemplate string            `json:"bodyTemplate"`
+	ExpectStatus []int             `json:"expectStatus"`
+	Capture      map[string]string `json:"capture"`
+}
+
+// TemplateVars are the variables available to a bodyTemplate or header
+// value. Vars holds whatever earlier steps in the same iteration captured
+// off their responses (see RequestSpec.Capture), keyed by capture name.
+type TemplateVars struct {
+	Iteration int
+	Timestamp int64
+	Rand      int64
+	Vars      map[string]string
+}
+
+// steps returns the ordered list of requests a tester makes per iteration,
+// falling back to a single step built from the tester's own fields when
+// `steps` isn't set.
+func (t *Tester) steps() []RequestSpec {
+	if len(t.Steps) > 0 {
+		return t.Steps
+	}
+
+	return []RequestSpec{{
+		Method:       t.Method,
+		URL:          t.URL,
+		Headers:      t.Headers,
+		Body:         t.Body,
+		BodyTemplate: t.BodyTemplate,
+		ExpectStatus: t.ExpectStatus,
+	}}
+}
+
+// runIteration executes every step of a tester's scenario in sequence and
+// returns the final step's response (or the error that stopped the chain,
+// or the response of a non-final step that failed its own expectStatus)
+// along with the expectStatus list that response should be judged against.
+func runIteration(client *http.Client, tester Tester, iteration int) (*http.Response, []int, error) {
+	specs := tester.steps()
+
+	vars := TemplateVars{
+		Iteration: iteration,
+		Timestamp: time.Now().Unix(),
+		Rand:      rand.Int63(),
+	}
+
+	var resp *http.Response
+	for idx, spec := range specs {
+		var err error
+		resp, err = doRequest(client, spec, vars)
+		if err != nil {
+			return nil, spec.ExpectStatus, err
+		}
+
+		isLast := idx == len(specs)-1
+		if !isLast {
+			if spec.ExpectStatus != nil && !containsStatus(spec.ExpectStatus, resp.StatusCode) {
+				// an intermediate step failed; stop the chain here so the
+				// caller sees the step that actually broke.
+				return resp, spec.ExpectStatus, nil
+			}
+
+			if isSuccessStatus(resp.StatusCode, spec.ExpectStatus) {
+				// only capture off a response the step itself accepted --
+				// a 429/503 rate-limit page or a 5xx error page on a login
+				// step isn't JSON, and that's a transient upstream problem
+				// for main's retry/backoff to handle, not a broken config.
+				if err := captureVars(resp, spec, &vars); err != nil {
+					drainAndClose(resp)
+					return nil, spec.ExpectStatus, err
+				}
+			}
+			drainAndClose(resp)
+		}
+	}
+
+	return resp, specs[len(specs)-1].ExpectStatus, nil
+}
+
+// ConfigError marks a failure that comes from the tester's own
+// configuration -- an unreadable @file body, or a bodyTemplate/header/
+// capture that doesn't parse -- rather than a transient failure talking to
+// the target. Unlike a request timeout or a 5xx, retrying this with
+// backoff can never succeed, so main treats it as fatal for the tester
+// instead of backing off forever.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string { return e.Err.Error() }
+func (e *ConfigError) Unwrap() error { return e.Err }
+
+func doRequest(client *http.Client, spec RequestSpec, vars TemplateVars) (*http.Response, error) {
+	method := spec.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	body, err := requestBody(spec, vars)
+	if err != nil {
+		return nil, &ConfigError{Err: fmt.Errorf("building request body: %w", err)}
+	}
+
+	headers, err := renderHeaders(spec.Headers, vars)
+	if err != nil {
+		return nil, &ConfigError{Err: fmt.Errorf("rendering headers: %w", err)}
+	}
+
+	req, err := http.NewRequest(method, spec.URL, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	return client.Do(req)
+}
+
+// renderHeaders evaluates any header value containing "{{" as a
+// text/template against vars, the same way a bodyTemplate is evaluated, so
+// a later step can send a token an earlier step captured (e.g.
+// "Authorization: Bearer {{.Vars.token}}"). Headers with no template
+// syntax pass through untouched.
+func renderHeaders(headers map[string]string, vars TemplateVars) (map[string]string, error) {
+	if len(headers) == 0 {
+		return headers, nil
+	}
+
+	rendered := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if !strings.Contains(v, "{{") {
+			rendered[k] = v
+			continue
+		}
+
+		tmpl, err := template.New("header").Parse(v)
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, vars); err != nil {
+			return nil, err
+		}
+		rendered[k] = buf.String()
+	}
+
+	return rendered, nil
+}
+
+// captureVars pulls values out of an intermediate step's response and adds
+// them to vars.Vars for later steps to use, per spec.Capture (see
+// RequestSpec.Capture).
+//
+// An unknown capture source is a ConfigError: the tester was written wrong
+// and no retry fixes that. A response body that won't parse as JSON is not
+// -- that's the target misbehaving on this one call, same as any other
+// runtime hiccup -- so it comes back as a plain error for main's normal
+// retry/backoff to handle.
+func captureVars(resp *http.Response, spec RequestSpec, vars *TemplateVars) error {
+	if len(spec.Capture) == 0 {
+		return nil
+	}
+
+	needsBody := false
+	for _, src := range spec.Capture {
+		if !strings.HasPrefix(src, "header:") && !strings.HasPrefix(src, "json:") {
+			return &ConfigError{Err: fmt.Errorf("capture: unknown source %q (want header:<name> or json:<field>)", src)}
+		}
+		if strings.HasPrefix(src, "json:") {
+			needsBody = true
+		}
+	}
+
+	var decoded map[string]interface{}
+	if needsBody {
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("reading response for capture: %w", err)
+		}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			return fmt.Errorf("response body isn't valid json: %w", err)
+		}
+	}
+
+	if vars.Vars == nil {
+		vars.Vars = make(map[string]string, len(spec.Capture))
+	}
+
+	for name, src := range spec.Capture {
+		switch {
+		case strings.HasPrefix(src, "header:"):
+			vars.Vars[name] = resp.Header.Get(strings.TrimPrefix(src, "header:"))
+		case strings.HasPrefix(src, "json:"):
+			field := strings.TrimPrefix(src, "json:")
+			if v, ok := decoded[field]; ok {
+				vars.Vars[name] = fmt.Sprintf("%v", v)
+			}
+		}
+	}
+
+	return nil
+}
+
+// requestBody resolves a step's body: a bodyTemplate takes precedence and
+// is evaluated with vars, otherwise a `body` starting with "@" is read
+// from the named file, and anything else is used verbatim.
+func requestBody(spec RequestSpec, vars TemplateVars) (string, error) {
+	if spec.BodyTemplate != "" {
+		tmpl, err := template.New("body").Parse(spec.BodyTemplate)
+		if err != nil {
+			return "", err
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, vars); err != nil {
+			return "", err
+		}
+
+		return buf.String(), nil
+	}
+
+	if strings.HasPrefix(spec.Body, "@") {
+		data, err := os.ReadFile(spec.Body[1:])
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+
+	return spec.Body, nil
+}
+
+// isSuccessStatus reports whether status counts as a success for a step.
+// With an explicit expectStatus list, only those codes count; otherwise
+// the legacy 2xx rule applies.
+func isSuccessStatus(status int, expectStatus []int) bool {
+	if len(expectStatus) > 0 {
+		return containsStatus(expectStatus, status)
+	}
+	return status >= 200 && status < 300
+}
+
+// isErrorStatus reports whether status counts as an error for a step, i.e.
+// anything that isn't a success. With no expectStatus list this preserves
+// the legacy 4xx rule.
+func isErrorStatus(status int, expectStatus []int) bool {
+	if len(expectStatus) > 0 {
+		return !isSuccessStatus(status, expectStatus)
+	}
+	return status > 400 && status < 500
+}
+
+func containsStatus(statuses []int, status int) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// drainAndClose discards a response body and closes it so the underlying
+// connection can be reused by the transport.
+func drainAndClose(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
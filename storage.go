@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Error and rate-limit events land on the hot path (once per request), so
+// both store backends buffer them in memory and write them out as a single
+// multi-row INSERT instead of one round-trip per event. errorBatchSize/
+// rateLimitBatchSize cap how long a buffer is allowed to grow before a
+// partial flush happens anyway; batchFlushInterval is the upper bound on
+// how stale a buffered-but-unflushed event can get.
+const (
+	errorBatchSize     = 50
+	rateLimitBatchSize = 50
+	batchFlushInterval = 500 * time.Millisecond
+)
+
+// bufferedError is one LogError call waiting to be flushed.
+type bufferedError struct {
+	name, kind, errMsg string
+	status             int
+	waitSeconds        float64
+	timestamp          int64
+}
+
+// bufferedRateLimit is one LogRateLimit call waiting to be flushed.
+type bufferedRateLimit struct {
+	name              string
+	retryAfterSeconds float64
+	requestCount      int
+	effectiveRPS      float64
+	timestamp         int64
+}
+
+// batchedLog is the buffer+ticker+flush machinery shared by every Store
+// backend: LogError/LogRateLimit append to an in-memory buffer and return
+// immediately, and a background goroutine (or a buffer hitting
+// errorBatchSize/rateLimitBatchSize) flushes it as one batch via the
+// driver-supplied flushErrors/flushRateLimits funcs, which turn a pending
+// slice into a single multi-row INSERT in that driver's own placeholder
+// dialect.
+type batchedLog struct {
+	errorMu  sync.Mutex
+	errorBuf []bufferedError
+
+	rateLimitMu  sync.Mutex
+	rateLimitBuf []bufferedRateLimit
+
+	flushErrorsFn     func([]bufferedError)
+	flushRateLimitsFn func([]bufferedRateLimit)
+
+	ticker *time.Ticker
+	done   chan struct{}
+}
+
+// newBatchedLog starts the background flush loop immediately; call close
+// when the owning store is closed.
+func newBatchedLog(flushErrors func([]bufferedError), flushRateLimits func([]bufferedRateLimit)) *batchedLog {
+	b := &batchedLog{
+		flushErrorsFn:     flushErrors,
+		flushRateLimitsFn: flushRateLimits,
+		ticker:            time.NewTicker(batchFlushInterval),
+		done:              make(chan struct{}),
+	}
+	go b.loop()
+	return b
+}
+
+// loop periodically flushes whatever's buffered so a slow tester doesn't
+// leave events sitting in memory indefinitely between bursts.
+func (b *batchedLog) loop() {
+	for {
+		select {
+		case <-b.ticker.C:
+			b.flushErrors()
+			b.flushRateLimits()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *batchedLog) logError(e bufferedError) {
+	b.errorMu.Lock()
+	b.errorBuf = append(b.errorBuf, e)
+	full := len(b.errorBuf) >= errorBatchSize
+	b.errorMu.Unlock()
+
+	if full {
+		b.flushErrors()
+	}
+}
+
+func (b *batchedLog) logRateLimit(e bufferedRateLimit) {
+	b.rateLimitMu.Lock()
+	b.rateLimitBuf = append(b.rateLimitBuf, e)
+	full := len(b.rateLimitBuf) >= rateLimitBatchSize
+	b.rateLimitMu.Unlock()
+
+	if full {
+		b.flushRateLimits()
+	}
+}
+
+func (b *batchedLog) flushErrors() {
+	b.errorMu.Lock()
+	pending := b.errorBuf
+	b.errorBuf = nil
+	b.errorMu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+	b.flushErrorsFn(pending)
+}
+
+func (b *batchedLog) flushRateLimits() {
+	b.rateLimitMu.Lock()
+	pending := b.rateLimitBuf
+	b.rateLimitBuf = nil
+	b.rateLimitMu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+	b.flushRateLimitsFn(pending)
+}
+
+// close stops the background flush loop and flushes whatever is still
+// buffered. The owning store should call this before closing its db.
+func (b *batchedLog) close() {
+	close(b.done)
+	b.ticker.Stop()
+	b.flushErrors()
+	b.flushRateLimits()
+}
+
+// StorageConfig is the JSON shape of a config's `storage` block. Driver
+// selects the backend ("sqlite"/"sqlite3", the default, or "postgres");
+// MaxOpenConns/MaxIdleConns size the underlying connection pool and are
+// ignored by drivers that don't use one.
+type StorageConfig struct {
+	Driver       string `json:"driver"`
+	DSN          string `json:"dsn"`
+	MaxOpenConns int    `json:"maxOpenConns"`
+	MaxIdleConns int    `json:"maxIdleConns"`
+}
+
+// Store is the persistence interface batches and errors are written
+// through. SQLiteStore backs single-process local runs; PostgresStore lets
+// multiple rateprowler instances share a central database. LogError and
+// LogRateLimit are buffered internally and flushed as batch inserts (see
+// errorBatchSize/rateLimitBatchSize/batchFlushInterval); Close flushes
+// whatever is still buffered before closing the underlying connection.
+type Store interface {
+	LogBatch(batch Batch) error
+	LogError(name, kind string, status int, errMsg string, wait time.Duration) error
+	// LogRateLimit records an observed 429/503 throttling event: the
+	// Retry-After the server asked for, how many requests had gone out
+	// before it, and the tester's effective req/s at that moment.
+	LogRateLimit(name string, retryAfter time.Duration, requestCount int, effectiveRPS float64) error
+	Close() error
+}
+
+// NewStore opens a Store for the given configuration. An empty (or
+// "sqlite"/"sqlite3") driver defaults to the local SQLite file rateprowler
+// has always used.
+func NewStore(cfg StorageConfig) (Store, error) {
+	switch cfg.Driver {
+	case "", "sqlite", "sqlite3":
+		dsn := cfg.DSN
+		if dsn == "" {
+			dsn = "rateprowler.db"
+		}
+		return newSQLiteStore(dsn, cfg)
+	case "postgres", "postgresql":
+		return newPostgresStore(cfg)
+	default:
+		return nil, fmt.Errorf("storage: unknown driver %q", cfg.Driver)
+	}
+}
+
+func applyPoolConfig(db interface {
+	SetMaxOpenConns(int)
+	SetMaxIdleConns(int)
+}, cfg StorageConfig) {
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// PostgresStore is a Store backed by a shared Postgres database, letting
+// multiple rateprowler instances write batches and errors to one place.
+type PostgresStore struct {
+	db      *sql.DB
+	logStmt *sql.Stmt
+	batched *batchedLog
+}
+
+func newPostgresStore(cfg StorageConfig) (*PostgresStore, error) {
+	if cfg.DSN == "" {
+		return nil, fmt.Errorf("storage: dsn is required for the postgres driver")
+	}
+
+	db, err := sql.Open("postgres", cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	applyPoolConfig(db, cfg)
+
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS log (
+			id BIGSERIAL PRIMARY KEY,
+			name VARCHAR(255),
+			successes BIGINT,
+			success_time VARCHAR(64),
+			failures BIGINT,
+			fail_time VARCHAR(64),
+			last_wait_seconds DOUBLE PRECISION,
+			timestamp BIGINT
+		)`); err != nil {
+		return nil, fmt.Errorf("failed to create table: %w", err)
+	}
+
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS errors (
+			id BIGSERIAL PRIMARY KEY,
+			name VARCHAR(255),
+			type VARCHAR(32),
+			status INT,
+			error TEXT,
+			wait_seconds DOUBLE PRECISION,
+			timestamp BIGINT
+		)`); err != nil {
+		return nil, fmt.Errorf("failed to create table: %w", err)
+	}
+
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS rate_limits (
+			id BIGSERIAL PRIMARY KEY,
+			name VARCHAR(255),
+			retry_after_seconds DOUBLE PRECISION,
+			request_count BIGINT,
+			effective_rps DOUBLE PRECISION,
+			timestamp BIGINT
+		)`); err != nil {
+		return nil, fmt.Errorf("failed to create table: %w", err)
+	}
+
+	logStmt, err := db.Prepare(`
+		INSERT INTO log (name, successes, success_time, failures, fail_time, last_wait_seconds, timestamp)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare log insert: %w", err)
+	}
+
+	s := &PostgresStore{db: db, logStmt: logStmt}
+	s.batched = newBatchedLog(s.flushErrors, s.flushRateLimits)
+
+	return s, nil
+}
+
+func (s *PostgresStore) LogBatch(batch Batch) error {
+	_, err := s.logStmt.Exec(batch.Name, batch.Successes, batch.SuccessTime.String(), batch.Failures, batch.FailTime.String(), batch.LastWaitSeconds, time.Now().Unix())
+	if err != nil {
+		fmt.Printf("failed to log request: %s", err)
+	}
+	return err
+}
+
+func (s *PostgresStore) LogError(name, kind string, status int, errMsg string, wait time.Duration) error {
+	s.batched.logError(bufferedError{
+		name:        name,
+		kind:        kind,
+		status:      status,
+		errMsg:      errMsg,
+		waitSeconds: wait.Seconds(),
+		timestamp:   time.Now().Unix(),
+	})
+	return nil
+}
+
+func (s *PostgresStore) LogRateLimit(name string, retryAfter time.Duration, requestCount int, effectiveRPS float64) error {
+	s.batched.logRateLimit(bufferedRateLimit{
+		name:              name,
+		retryAfterSeconds: retryAfter.Seconds(),
+		requestCount:      requestCount,
+		effectiveRPS:      effectiveRPS,
+		timestamp:         time.Now().Unix(),
+	})
+	return nil
+}
+
+// flushErrors turns a pending batch of LogError calls into a single
+// multi-row INSERT using Postgres's "$N" placeholders.
+func (s *PostgresStore) flushErrors(pending []bufferedError) {
+	placeholders := make([]string, len(pending))
+	args := make([]interface{}, 0, len(pending)*6)
+	for i, e := range pending {
+		base := i * 6
+		placeholders[i] = fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d)", base+1, base+2, base+3, base+4, base+5, base+6)
+		args = append(args, e.name, e.kind, e.status, e.errMsg, e.waitSeconds, e.timestamp)
+	}
+
+	query := "INSERT INTO errors (name, type, status, error, wait_seconds, timestamp) VALUES " + strings.Join(placeholders, ", ")
+	if _, err := s.db.Exec(query, args...); err != nil {
+		fmt.Printf("failed to flush batched errors: %s", err)
+	}
+}
+
+// flushRateLimits turns a pending batch of LogRateLimit calls into a
+// single multi-row INSERT using Postgres's "$N" placeholders.
+func (s *PostgresStore) flushRateLimits(pending []bufferedRateLimit) {
+	placeholders := make([]string, len(pending))
+	args := make([]interface{}, 0, len(pending)*5)
+	for i, e := range pending {
+		base := i * 5
+		placeholders[i] = fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", base+1, base+2, base+3, base+4, base+5)
+		args = append(args, e.name, e.retryAfterSeconds, e.requestCount, e.effectiveRPS, e.timestamp)
+	}
+
+	query := "INSERT INTO rate_limits (name, retry_after_seconds, request_count, effective_rps, timestamp) VALUES " + strings.Join(placeholders, ", ")
+	if _, err := s.db.Exec(query, args...); err != nil {
+		fmt.Printf("failed to flush batched rate limits: %s", err)
+	}
+}
+
+func (s *PostgresStore) Close() error {
+	s.batched.close()
+	s.logStmt.Close()
+	return s.db.Close()
+}
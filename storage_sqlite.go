@@ -0,0 +1,146 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLiteStore is the default Store, backed by a local SQLite file.
+type SQLiteStore struct {
+	db      *sql.DB
+	logStmt *sql.Stmt
+	batched *batchedLog
+}
+
+func newSQLiteStore(dsn string, cfg StorageConfig) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	applyPoolConfig(db, cfg)
+
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS log (
+			id INTEGER PRIMARY KEY,
+      name TEXT,
+			successes INTEGER,
+			success_time TEXT,
+			failures INTEGER,
+			fail_time TEXT,
+      last_wait_seconds REAL,
+			timestamp INT
+		)`); err != nil {
+		return nil, fmt.Errorf("failed to create table: %w", err)
+	}
+
+	if _, err := db.Exec(`
+      CREATE TABLE IF NOT EXISTS errors (
+      id INTEGER PRIMARY KEY,
+      name TEXT,
+      type TEXT,
+      status INT,
+      error TEXT,
+      wait_seconds REAL,
+      timestamp INT
+    )`); err != nil {
+		return nil, fmt.Errorf("failed to create table: %w", err)
+	}
+
+	if _, err := db.Exec(`
+      CREATE TABLE IF NOT EXISTS rate_limits (
+      id INTEGER PRIMARY KEY,
+      name TEXT,
+      retry_after_seconds REAL,
+      request_count INTEGER,
+      effective_rps REAL,
+      timestamp INT
+    )`); err != nil {
+		return nil, fmt.Errorf("failed to create table: %w", err)
+	}
+
+	logStmt, err := db.Prepare(`
+		INSERT INTO log (name, successes, success_time, failures, fail_time, last_wait_seconds, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare log insert: %w", err)
+	}
+
+	s := &SQLiteStore{db: db, logStmt: logStmt}
+	s.batched = newBatchedLog(s.flushErrors, s.flushRateLimits)
+
+	return s, nil
+}
+
+func (s *SQLiteStore) LogBatch(batch Batch) error {
+	_, err := s.logStmt.Exec(batch.Name, batch.Successes, batch.SuccessTime.String(), batch.Failures, batch.FailTime.String(), batch.LastWaitSeconds, time.Now().Unix())
+	if err != nil {
+		fmt.Printf("failed to log request: %s", err)
+	}
+	return err
+}
+
+func (s *SQLiteStore) LogError(name, kind string, status int, errMsg string, wait time.Duration) error {
+	s.batched.logError(bufferedError{
+		name:        name,
+		kind:        kind,
+		status:      status,
+		errMsg:      errMsg,
+		waitSeconds: wait.Seconds(),
+		timestamp:   time.Now().Unix(),
+	})
+	return nil
+}
+
+func (s *SQLiteStore) LogRateLimit(name string, retryAfter time.Duration, requestCount int, effectiveRPS float64) error {
+	s.batched.logRateLimit(bufferedRateLimit{
+		name:              name,
+		retryAfterSeconds: retryAfter.Seconds(),
+		requestCount:      requestCount,
+		effectiveRPS:      effectiveRPS,
+		timestamp:         time.Now().Unix(),
+	})
+	return nil
+}
+
+// flushErrors turns a pending batch of LogError calls into a single
+// multi-row INSERT using SQLite's "?" placeholders.
+func (s *SQLiteStore) flushErrors(pending []bufferedError) {
+	placeholders := make([]string, len(pending))
+	args := make([]interface{}, 0, len(pending)*6)
+	for i, e := range pending {
+		placeholders[i] = "(?, ?, ?, ?, ?, ?)"
+		args = append(args, e.name, e.kind, e.status, e.errMsg, e.waitSeconds, e.timestamp)
+	}
+
+	query := "INSERT INTO errors (name, type, status, error, wait_seconds, timestamp) VALUES " + strings.Join(placeholders, ", ")
+	if _, err := s.db.Exec(query, args...); err != nil {
+		fmt.Printf("failed to flush batched errors: %s", err)
+	}
+}
+
+// flushRateLimits turns a pending batch of LogRateLimit calls into a
+// single multi-row INSERT using SQLite's "?" placeholders.
+func (s *SQLiteStore) flushRateLimits(pending []bufferedRateLimit) {
+	placeholders := make([]string, len(pending))
+	args := make([]interface{}, 0, len(pending)*5)
+	for i, e := range pending {
+		placeholders[i] = "(?, ?, ?, ?, ?)"
+		args = append(args, e.name, e.retryAfterSeconds, e.requestCount, e.effectiveRPS, e.timestamp)
+	}
+
+	query := "INSERT INTO rate_limits (name, retry_after_seconds, request_count, effective_rps, timestamp) VALUES " + strings.Join(placeholders, ", ")
+	if _, err := s.db.Exec(query, args...); err != nil {
+		fmt.Printf("failed to flush batched rate limits: %s", err)
+	}
+}
+
+func (s *SQLiteStore) Close() error {
+	s.batched.close()
+	s.logStmt.Close()
+	return s.db.Close()
+}